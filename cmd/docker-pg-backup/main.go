@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/gofrs/flock"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/some-programs/docker-pg-backup/internal/dockerctl"
+	"github.com/some-programs/docker-pg-backup/internal/encrypt"
+	"github.com/some-programs/docker-pg-backup/internal/notify"
+	"github.com/some-programs/docker-pg-backup/internal/storage"
+	"github.com/some-programs/docker-pg-backup/internal/storage/local"
+	s3storage "github.com/some-programs/docker-pg-backup/internal/storage/s3"
+	sshstorage "github.com/some-programs/docker-pg-backup/internal/storage/ssh"
+	"github.com/some-programs/docker-pg-backup/internal/storage/webdav"
+)
+
+// Flags .
+type Flags struct {
+	Config            string
+	ContainerNameOrID string
+	DBName            string
+	DBUser            string
+	DockerStopLabel   string
+	RetentionDays     int
+	RetentionMin      int
+	PruningLeeway     time.Duration
+
+	CompressLevel int
+
+	Bucket             string
+	Endpoint           string
+	Prefix             string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	S3PartSize         uint64
+
+	LocalPath string
+
+	SSHAddr     string
+	SSHUser     string
+	SSHPassword string
+	SSHKeyFile  string
+	SSHPath     string
+
+	WebDAVURL      string
+	WebDAVUser     string
+	WebDAVPassword string
+	WebDAVPath     string
+
+	EncryptPassphrase     string
+	EncryptPassphraseFile string
+	EncryptRecipientsFile string
+
+	Schedule   string
+	NotifyURLs string
+	LockFile   string
+}
+
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Config, "config", "", "config file")
+	fs.StringVar(&f.ContainerNameOrID, "container", "", "container name or ID")
+	fs.StringVar(&f.DBName, "db.name", "", "database name")
+	fs.StringVar(&f.DBUser, "db.user", "", "database user")
+	fs.StringVar(&f.DockerStopLabel, "docker.stop_label", "docker-pg-backup.stop-during-backup", "label marking containers/services to stop for the duration of the backup")
+	fs.IntVar(&f.RetentionDays, "s3.retention_days", -1, "maximum age in days of backups to keep, -1 disables pruning")
+	fs.IntVar(&f.RetentionMin, "s3.retention_min", 1, "minimum number of most-recent backups to keep regardless of age")
+	fs.DurationVar(&f.PruningLeeway, "s3.pruning_leeway", time.Minute, "leeway before a backup is eligible for pruning, to avoid racing with the upload that just finished")
+
+	fs.IntVar(&f.CompressLevel, "compress.level", gzip.DefaultCompression, "gzip compression level, 1 (fastest) to 9 (smallest), -1 for the default")
+
+	fs.StringVar(&f.Bucket, "s3.bucket", "", "bucket name, enables the s3 backend")
+	fs.StringVar(&f.Endpoint, "s3.endpoint", "", "s3 endpoint")
+	fs.StringVar(&f.Prefix, "s3.prefix", "postgres-backups", "object/file name prefix, shared by all backends")
+	fs.StringVar(&f.AWSAccessKeyID, "aws.access_key_id", "", "aws access key id")
+	fs.StringVar(&f.AWSSecretAccessKey, "aws.secret_access_key", "", "aws secret access key")
+	fs.Uint64Var(&f.S3PartSize, "s3.part_size", 0, "multipart upload part size in bytes, 0 uses the minio-go default")
+
+	fs.StringVar(&f.LocalPath, "local.path", "", "directory to write backups to, enables the local backend")
+
+	fs.StringVar(&f.SSHAddr, "ssh.addr", "", "host:port of the remote server, enables the ssh/sftp backend")
+	fs.StringVar(&f.SSHUser, "ssh.user", "", "ssh user")
+	fs.StringVar(&f.SSHPassword, "ssh.password", "", "ssh password, if not using a key")
+	fs.StringVar(&f.SSHKeyFile, "ssh.key_file", "", "path to a private key, if not using a password")
+	fs.StringVar(&f.SSHPath, "ssh.path", "", "remote directory to write backups to")
+
+	fs.StringVar(&f.WebDAVURL, "webdav.url", "", "webdav server url, enables the webdav backend")
+	fs.StringVar(&f.WebDAVUser, "webdav.user", "", "webdav user")
+	fs.StringVar(&f.WebDAVPassword, "webdav.password", "", "webdav password")
+	fs.StringVar(&f.WebDAVPath, "webdav.path", "", "remote directory to write backups to")
+
+	fs.StringVar(&f.EncryptPassphrase, "encrypt.passphrase", "", "passphrase to symmetrically encrypt the dump with")
+	fs.StringVar(&f.EncryptPassphraseFile, "encrypt.passphrase_file", "", "path to a file containing the encryption passphrase")
+	fs.StringVar(&f.EncryptRecipientsFile, "encrypt.recipients_file", "", "path to an armored public keyring to asymmetrically encrypt the dump to")
+
+	fs.StringVar(&f.Schedule, "schedule", "", "cron expression to run backups on, e.g. \"0 3 * * *\"; if unset, runs once and exits")
+	fs.StringVar(&f.NotifyURLs, "notify.urls", "", "comma-separated shoutrrr URLs to send success/failure notifications to")
+	fs.StringVar(&f.LockFile, "lock.file", "/var/run/docker-pg-backup.lock", "lock file preventing overlapping scheduled runs")
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		if err := Decrypt(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := Restore(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fs := flag.NewFlagSet("docker-pg-backup", flag.ContinueOnError)
+	var flags Flags
+	flags.Register(fs)
+
+	if err := ff.Parse(fs, os.Args[1:],
+		ff.WithEnvVarPrefix("S3_BACKUP"),
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(ff.PlainParser),
+	); err != nil {
+		log.Fatal(err)
+	}
+	if flags.AWSSecretAccessKey != "" {
+		os.Setenv("AWS_SECRET_ACCESS_KEY", flags.AWSSecretAccessKey)
+	}
+	if flags.AWSAccessKeyID != "" {
+		os.Setenv("AWS_ACCESS_KEY_ID", flags.AWSAccessKeyID)
+	}
+
+	n, err := notify.New(flags.NotifyURLs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if flags.Schedule != "" {
+		if err := runScheduler(ctx, flags, n); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	stats, err := Backup(ctx, flags)
+	logResult(n, stats, err)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runScheduler runs Backup on flags.Schedule forever, using flags.LockFile to
+// skip a run if the previous one is still uploading rather than piling up
+// concurrent dumps.
+func runScheduler(ctx context.Context, flags Flags, n *notify.Sender) error {
+	c := cron.New()
+	_, err := c.AddFunc(flags.Schedule, func() {
+		// A fresh Flock per run: TryLock on a Flock that already holds the
+		// lock reports success, so a shared one would not detect overlap.
+		fl := flock.New(flags.LockFile)
+		locked, err := fl.TryLock()
+		if err != nil {
+			log.Printf("schedule: lock %s: %v", flags.LockFile, err)
+			return
+		}
+		if !locked {
+			log.Printf("schedule: previous run still holds %s, skipping", flags.LockFile)
+			return
+		}
+		defer fl.Unlock()
+
+		stats, err := Backup(ctx, flags)
+		logResult(n, stats, err)
+	})
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+
+	log.Printf("schedule: running on %q", flags.Schedule)
+	c.Start()
+	select {}
+}
+
+// logResult logs and notifies the outcome of a Backup run.
+func logResult(n *notify.Sender, stats RunStats, runErr error) {
+	if runErr != nil {
+		log.Printf("backup failed after %s: %v", stats.Duration, runErr)
+		if err := n.Send(fmt.Sprintf("docker-pg-backup: backup failed after %s: %v", stats.Duration, runErr)); err != nil {
+			log.Printf("notify: %v", err)
+		}
+		return
+	}
+
+	log.Printf("backup: %s, %d bytes, %d pruned, started %s, took %s",
+		stats.Object, stats.Bytes, stats.Pruned, stats.Start.Format(time.RFC3339), stats.Duration)
+	msg := fmt.Sprintf("docker-pg-backup: backed up %s (%d bytes) in %s", stats.Object, stats.Bytes, stats.Duration)
+	if err := n.Send(msg); err != nil {
+		log.Printf("notify: %v", err)
+	}
+}
+
+// Decrypt is the `decrypt` subcommand: it downloads an object from S3 and
+// streams its decrypted contents to stdout, for operators to verify a
+// backup was encrypted the way they expect.
+func Decrypt(args []string) error {
+	fs := flag.NewFlagSet("docker-pg-backup decrypt", flag.ContinueOnError)
+	var flags Flags
+	flags.Register(fs)
+	var object string
+	fs.StringVar(&object, "s3.object", "", "s3 object to decrypt")
+
+	if err := ff.Parse(fs, args,
+		ff.WithEnvVarPrefix("S3_BACKUP"),
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(ff.PlainParser),
+	); err != nil {
+		return err
+	}
+	if flags.AWSSecretAccessKey != "" {
+		os.Setenv("AWS_SECRET_ACCESS_KEY", flags.AWSSecretAccessKey)
+	}
+	if flags.AWSAccessKeyID != "" {
+		os.Setenv("AWS_ACCESS_KEY_ID", flags.AWSAccessKeyID)
+	}
+	if object == "" {
+		return fmt.Errorf("decrypt: -s3.object is required")
+	}
+
+	encCfg, err := encrypt.NewConfig(flags.EncryptPassphrase, flags.EncryptPassphraseFile, flags.EncryptRecipientsFile)
+	if err != nil {
+		return err
+	}
+
+	s, err := s3storage.New(flags.Endpoint, flags.Bucket, flags.S3PartSize)
+	if err != nil {
+		return err
+	}
+
+	r, err := s.Get(context.Background(), object)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	plain, err := encrypt.DecryptReader(r, encCfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(os.Stdout, plain)
+	return err
+}
+
+// Restore is the `restore` subcommand: it downloads an object from S3
+// (optionally decrypting and always ungzipping it) and streams it into
+// `docker exec -i <container> psql`.
+func Restore(args []string) error {
+	fs := flag.NewFlagSet("docker-pg-backup restore", flag.ContinueOnError)
+	var flags Flags
+	flags.Register(fs)
+	var object string
+	var dryRun, createDB, clean bool
+	fs.StringVar(&object, "s3.object", "latest", `s3 object to restore, or "latest" to pick the most recent under the prefix`)
+	fs.BoolVar(&dryRun, "restore.dry_run", false, "print the number of statements the restore would execute instead of running it")
+	fs.BoolVar(&createDB, "restore.create_db", false, "create the database via the postgres maintenance database before restoring")
+	fs.BoolVar(&clean, "restore.clean", false, "drop and recreate the database before restoring")
+
+	if err := ff.Parse(fs, args,
+		ff.WithEnvVarPrefix("S3_BACKUP"),
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(ff.PlainParser),
+	); err != nil {
+		return err
+	}
+	if flags.AWSSecretAccessKey != "" {
+		os.Setenv("AWS_SECRET_ACCESS_KEY", flags.AWSSecretAccessKey)
+	}
+	if flags.AWSAccessKeyID != "" {
+		os.Setenv("AWS_ACCESS_KEY_ID", flags.AWSAccessKeyID)
+	}
+
+	encCfg, err := encrypt.NewConfig(flags.EncryptPassphrase, flags.EncryptPassphraseFile, flags.EncryptRecipientsFile)
+	if err != nil {
+		return err
+	}
+
+	s, err := s3storage.New(flags.Endpoint, flags.Bucket, flags.S3PartSize)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if object == "" || object == "latest" {
+		object, err = s.Latest(ctx, flags.Prefix, flags.DBName)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("restore: restoring from %s", object)
+
+	r, err := s.Get(ctx, object)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var plain io.Reader = r
+	if strings.HasSuffix(object, ".gpg") {
+		plain, err = encrypt.DecryptReader(r, encCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	zr, err := gzip.NewReader(plain)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	if dryRun {
+		return countStatements(zr)
+	}
+
+	if createDB {
+		stmt := fmt.Sprintf("CREATE DATABASE %s;", flags.DBName)
+		if err := runPsql(ctx, flags.ContainerNameOrID, flags.DBUser, "postgres", strings.NewReader(stmt)); err != nil {
+			return err
+		}
+	}
+	if clean {
+		stmt := fmt.Sprintf("DROP DATABASE IF EXISTS %s; CREATE DATABASE %s;", flags.DBName, flags.DBName)
+		if err := runPsql(ctx, flags.ContainerNameOrID, flags.DBUser, "postgres", strings.NewReader(stmt)); err != nil {
+			return err
+		}
+	}
+
+	return runPsql(ctx, flags.ContainerNameOrID, flags.DBUser, flags.DBName, zr)
+}
+
+// runPsql streams r into `docker exec -i container psql -U user -d db`.
+func runPsql(ctx context.Context, container, user, db string, r io.Reader) error {
+	args := []string{"exec", "-i", container, "psql", "-U", user, "-d", db}
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// countStatements prints the number of semicolon-terminated lines in r. It's
+// a rough proxy for the number of statements -restore.dry_run would execute,
+// good enough to sanity-check the object before committing to a restore, but
+// not a real SQL parse.
+func countStatements(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var count int
+	for scanner.Scan() {
+		if strings.HasSuffix(strings.TrimSpace(scanner.Text()), ";") {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d statements\n", count)
+	return nil
+}
+
+// buildStorageBackends constructs a Storage for every backend the flags
+// configure. Backup fans out to all of them. Decrypt and Restore construct
+// their S3 backend directly instead.
+func buildStorageBackends(flags Flags) ([]storage.Storage, error) {
+	var backends []storage.Storage
+
+	if flags.Bucket != "" {
+		s, err := s3storage.New(flags.Endpoint, flags.Bucket, flags.S3PartSize)
+		if err != nil {
+			return nil, fmt.Errorf("s3: %w", err)
+		}
+		backends = append(backends, s)
+	}
+
+	if flags.LocalPath != "" {
+		backends = append(backends, local.New(flags.LocalPath))
+	}
+
+	if flags.SSHAddr != "" {
+		var auth ssh.AuthMethod
+		switch {
+		case flags.SSHKeyFile != "":
+			key, err := os.ReadFile(flags.SSHKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("ssh: %w", err)
+			}
+			signer, err := ssh.ParsePrivateKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("ssh: %w", err)
+			}
+			auth = ssh.PublicKeys(signer)
+		default:
+			auth = ssh.Password(flags.SSHPassword)
+		}
+
+		s, err := sshstorage.New(flags.SSHAddr, flags.SSHUser, auth, ssh.InsecureIgnoreHostKey(), flags.SSHPath)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: %w", err)
+		}
+		backends = append(backends, s)
+	}
+
+	if flags.WebDAVURL != "" {
+		backends = append(backends, webdav.New(flags.WebDAVURL, flags.WebDAVUser, flags.WebDAVPassword, flags.WebDAVPath))
+	}
+
+	return backends, nil
+}
+
+// closeStorageBackends releases any backend holding an open connection
+// (e.g. ssh's SFTP session), so a long-lived scheduler process doesn't leak
+// one per Backup run.
+func closeStorageBackends(backends []storage.Storage) {
+	for _, s := range backends {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("%s: close: %v", s.Name(), err)
+			}
+		}
+	}
+}
+
+// RunStats is the structured record of a single Backup run, used for
+// logging and notifications.
+type RunStats struct {
+	Start    time.Time
+	Duration time.Duration
+	Bytes    int64
+	Object   string
+	Pruned   int
+}
+
+// countingWriter tallies the number of bytes written through it, so Backup
+// can report RunStats.Bytes without each storage.Storage needing to do so.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// fanoutWriter writes every chunk to each of writers independently. Unlike
+// io.MultiWriter, one writer's error doesn't stop the chunk from reaching
+// the rest: a failing backend is marked dead and skipped from then on,
+// while the others keep receiving the dump unaffected. Write only fails
+// once every writer has failed, since at that point there is nowhere left
+// for the dump to go.
+type fanoutWriter struct {
+	writers []io.Writer
+	dead    []bool
+}
+
+func newFanoutWriter(writers []io.Writer) *fanoutWriter {
+	return &fanoutWriter{writers: writers, dead: make([]bool, len(writers))}
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	alive := false
+	for i, w := range f.writers {
+		if f.dead[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			f.dead[i] = true
+			continue
+		}
+		alive = true
+	}
+	if !alive {
+		return 0, fmt.Errorf("fanout: every destination failed")
+	}
+	return len(p), nil
+}
+
+func Backup(ctx context.Context, flags Flags) (stats RunStats, err error) {
+	stats = RunStats{Start: time.Now()}
+	defer func() { stats.Duration = time.Since(stats.Start) }()
+
+	backends, err := buildStorageBackends(flags)
+	if err != nil {
+		return stats, err
+	}
+	if len(backends) == 0 {
+		return stats, fmt.Errorf("no storage backend configured")
+	}
+	defer closeStorageBackends(backends)
+
+	dockerCli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		return stats, err
+	}
+	defer dockerCli.Close()
+
+	restore, err := dockerctl.Quiesce(ctx, dockerCli, flags.DockerStopLabel)
+	quiesceCtx := ctx
+	defer func() {
+		if err := restore(quiesceCtx); err != nil {
+			log.Println(err)
+		}
+	}()
+	if err != nil {
+		return stats, err
+	}
+
+	encCfg, err := encrypt.NewConfig(flags.EncryptPassphrase, flags.EncryptPassphraseFile, flags.EncryptRecipientsFile)
+	if err != nil {
+		return stats, err
+	}
+
+	suffix := ".sql.gz"
+	if encCfg.Enabled() {
+		suffix = ".sql.gz.gpg"
+	}
+	remoteName := path.Join(flags.Prefix, flags.DBName, time.Now().UTC().Format("2006-01-02T15_04_05.999999999")+suffix)
+	stats.Object = remoteName
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pipeReaders := make([]*io.PipeReader, len(backends))
+	writers := make([]io.Writer, len(backends))
+	for i := range backends {
+		pr, pw := io.Pipe()
+		pipeReaders[i] = pr
+		writers[i] = pw
+	}
+	counter := &countingWriter{}
+
+	// copyErrs is indexed like backends, so a failure can be attributed back
+	// to the backend that caused it and that backend alone skips Prune.
+	copyErrs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, s := range backends {
+		wg.Add(1)
+		go func(i int, pr *io.PipeReader, s storage.Storage) {
+			defer wg.Done()
+			err := s.Copy(ctx, pr, remoteName)
+			pr.CloseWithError(err)
+			if err != nil {
+				copyErrs[i] = fmt.Errorf("%s: %w", s.Name(), err)
+			}
+		}(i, pipeReaders[i], s)
+	}
+
+	dumpErr := DumpDB(ctx, newFanoutWriter(append(writers, counter)), flags.ContainerNameOrID, flags.DBName, flags.DBUser, flags.CompressLevel, encCfg)
+	for _, w := range writers {
+		w.(*io.PipeWriter).CloseWithError(dumpErr)
+	}
+
+	wg.Wait()
+	stats.Bytes = counter.n
+
+	var errs []error
+	if dumpErr != nil {
+		errs = append(errs, fmt.Errorf("dump: %w", dumpErr))
+	}
+	for _, err := range copyErrs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i, s := range backends {
+		if copyErrs[i] != nil || flags.RetentionDays < 0 {
+			continue
+		}
+		pruneStats, err := s.Prune(ctx, storage.Policy{
+			Prefix:  flags.Prefix,
+			DBName:  flags.DBName,
+			Days:    flags.RetentionDays,
+			MinKeep: flags.RetentionMin,
+			Leeway:  flags.PruningLeeway,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: prune: %w", s.Name(), err))
+			continue
+		}
+		stats.Pruned += pruneStats.Pruned
+		log.Printf("%s: kept %d, pruned %d", s.Name(), pruneStats.Kept, pruneStats.Pruned)
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// DumpDB runs pg_dump in container and streams gzip-compressed (and, if
+// encCfg is enabled, encrypted) output to w. Nothing is written to disk:
+// pg_dump's stdout feeds a gzip.Writer that feeds w directly, so w can be
+// one end of an io.Pipe into an upload.
+func DumpDB(ctx context.Context, w io.Writer, container, db, user string, compressLevel int, encCfg encrypt.Config) error {
+
+	args := []string{
+		"exec", container,
+		"pg_dump",
+		"-U", user,
+		db,
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	dst := w
+	var enc io.WriteCloser
+	if encCfg.Enabled() {
+		enc, err = encrypt.EncryptWriter(w, encCfg)
+		if err != nil {
+			return err
+		}
+		dst = enc
+	}
+
+	zw, err := gzip.NewWriterLevel(dst, compressLevel)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	copyErrCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(zw, stdout)
+		copyErrCh <- err
+	}()
+
+	// Drain stdout to EOF before Wait: Wait closes the StdoutPipe's read end
+	// as soon as the process exits, and calling it first can truncate the
+	// copy goroutine's read mid-dump.
+	copyErr := <-copyErrCh
+	waitErr := cmd.Wait()
+
+	if err := zw.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil && copyErr == nil {
+			copyErr = err
+		}
+	}
+
+	if waitErr != nil {
+		return waitErr
+	}
+	return copyErr
+}
@@ -0,0 +1,120 @@
+// Package dockerctl stops and restarts containers/services around a backup
+// so apps that need write quiescence can be paused for pg_dump.
+package dockerctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// swarmServiceLabel is the label docker stamps onto containers belonging to
+// a swarm service.
+const swarmServiceLabel = "com.docker.swarm.service.id"
+
+type action struct {
+	containerID string
+	serviceID   string
+	replicas    uint64
+}
+
+// Quiesce stops every container labeled label=true and returns a restore
+// func that brings them back. Containers belonging to a swarm service are
+// scaled to 0 replicas and back instead of being stopped directly; this
+// requires the service to run in replicated mode, so a global-mode service
+// carrying the label makes Quiesce return an error.
+//
+// restore must be called exactly once, via a single deferred closure right
+// after Quiesce returns, so a panic or early error during the backup still
+// restores the original state.
+func Quiesce(ctx context.Context, cli *client.Client, label string) (restore func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", label+"=true")),
+	})
+	if err != nil {
+		return noop, err
+	}
+
+	seenServices := map[string]bool{}
+	var actions []action
+
+	for _, c := range containers {
+		serviceID, isService := c.Labels[swarmServiceLabel]
+		if isService {
+			if seenServices[serviceID] {
+				continue
+			}
+			seenServices[serviceID] = true
+
+			svc, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+			if err != nil {
+				return restoreFunc(cli, actions), err
+			}
+
+			if svc.Spec.Mode.Replicated == nil {
+				return restoreFunc(cli, actions), fmt.Errorf("dockerctl: service %s is not in replicated mode, cannot quiesce by scaling", serviceID)
+			}
+
+			var replicas uint64
+			if svc.Spec.Mode.Replicated.Replicas != nil {
+				replicas = *svc.Spec.Mode.Replicated.Replicas
+			}
+
+			zero := uint64(0)
+			svc.Spec.Mode.Replicated.Replicas = &zero
+			if _, err := cli.ServiceUpdate(ctx, svc.ID, svc.Version, svc.Spec, types.ServiceUpdateOptions{}); err != nil {
+				return restoreFunc(cli, actions), err
+			}
+
+			actions = append(actions, action{serviceID: serviceID, replicas: replicas})
+			continue
+		}
+
+		if err := cli.ContainerStop(ctx, c.ID, container.StopOptions{}); err != nil {
+			return restoreFunc(cli, actions), err
+		}
+		actions = append(actions, action{containerID: c.ID})
+	}
+
+	return restoreFunc(cli, actions), nil
+}
+
+// restoreFunc undoes actions in reverse order, so the most recently stopped
+// container/service is restarted first.
+func restoreFunc(cli *client.Client, actions []action) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var errs []error
+		for i := len(actions) - 1; i >= 0; i-- {
+			a := actions[i]
+			if a.serviceID != "" {
+				svc, _, err := cli.ServiceInspectWithRaw(ctx, a.serviceID, types.ServiceInspectOptions{})
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if svc.Spec.Mode.Replicated == nil {
+					errs = append(errs, fmt.Errorf("dockerctl: service %s is no longer in replicated mode, cannot restore replica count", a.serviceID))
+					continue
+				}
+				replicas := a.replicas
+				svc.Spec.Mode.Replicated.Replicas = &replicas
+				if _, err := cli.ServiceUpdate(ctx, svc.ID, svc.Version, svc.Spec, types.ServiceUpdateOptions{}); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			if err := cli.ContainerStart(ctx, a.containerID, types.ContainerStartOptions{}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,83 @@
+// Package encrypt adds optional OpenPGP encryption of backup dumps, either
+// symmetric (a shared passphrase) or asymmetric (a recipient keyring).
+package encrypt
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// Config selects how EncryptWriter/DecryptReader transform data. Passphrase
+// takes priority over Recipients when both are set.
+type Config struct {
+	Passphrase string
+	Recipients openpgp.EntityList
+}
+
+// Enabled reports whether cfg configures encryption at all.
+func (c Config) Enabled() bool {
+	return c.Passphrase != "" || len(c.Recipients) > 0
+}
+
+// NewConfig builds a Config from raw flag values, reading passphraseFile and
+// recipientsFile if set. Either may be empty.
+func NewConfig(passphrase, passphraseFile, recipientsFile string) (Config, error) {
+	if passphraseFile != "" {
+		b, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return Config{}, err
+		}
+		passphrase = strings.TrimSpace(string(b))
+	}
+
+	var recipients openpgp.EntityList
+	if recipientsFile != "" {
+		var err error
+		recipients, err = LoadRecipients(recipientsFile)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	return Config{Passphrase: passphrase, Recipients: recipients}, nil
+}
+
+// LoadRecipients parses an armored public keyring from path.
+func LoadRecipients(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadArmoredKeyRing(f)
+}
+
+// EncryptWriter wraps w so writes to the returned WriteCloser are encrypted
+// per cfg, symmetrically if cfg.Passphrase is set, otherwise to
+// cfg.Recipients. Close must be called to flush the OpenPGP footer.
+func EncryptWriter(w io.Writer, cfg Config) (io.WriteCloser, error) {
+	if cfg.Passphrase != "" {
+		return openpgp.SymmetricallyEncrypt(w, []byte(cfg.Passphrase), nil, nil)
+	}
+	return openpgp.Encrypt(w, cfg.Recipients, nil, nil, nil)
+}
+
+// DecryptReader returns a reader over the decrypted contents of r, the
+// inverse of EncryptWriter.
+func DecryptReader(r io.Reader, cfg Config) (io.Reader, error) {
+	var prompt openpgp.PromptFunction
+	if cfg.Passphrase != "" {
+		prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+			return []byte(cfg.Passphrase), nil
+		}
+	}
+
+	md, err := openpgp.ReadMessage(r, cfg.Recipients, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return md.UnverifiedBody, nil
+}
@@ -0,0 +1,46 @@
+// Package notify sends run-result notifications through shoutrrr, so
+// operators can wire backup success/failure into Slack, Discord, email, and
+// anything else shoutrrr supports.
+package notify
+
+import (
+	"strings"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/containrrr/shoutrrr/pkg/router"
+)
+
+// Sender delivers messages to a fixed set of shoutrrr URLs. The zero value
+// is valid and Send is then a no-op, so callers don't need to special-case
+// "no URLs configured".
+type Sender struct {
+	sender *router.ServiceRouter
+}
+
+// New builds a Sender from a comma-separated list of shoutrrr URLs. An empty
+// urls yields a Sender whose Send is a no-op.
+func New(urls string) (*Sender, error) {
+	if urls == "" {
+		return &Sender{}, nil
+	}
+
+	s, err := shoutrrr.CreateSender(strings.Split(urls, ",")...)
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{sender: s}, nil
+}
+
+// Send delivers message to every configured URL, returning the first error
+// encountered, if any.
+func (s *Sender) Send(message string) error {
+	if s.sender == nil {
+		return nil
+	}
+	for _, err := range s.sender.Send(message, nil) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Package local is a storage.Storage backend that writes backups to a
+// directory on the local filesystem.
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/some-programs/docker-pg-backup/internal/storage"
+)
+
+// Storage writes backups under baseDir.
+type Storage struct {
+	baseDir string
+}
+
+// New constructs a Storage rooted at baseDir.
+func New(baseDir string) *Storage {
+	return &Storage{baseDir: baseDir}
+}
+
+func (s *Storage) Name() string { return "local" }
+
+// Copy streams r to baseDir/remoteName.
+func (s *Storage) Copy(ctx context.Context, r io.Reader, remoteName string) error {
+	dst := filepath.Join(s.baseDir, remoteName)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// Prune removes files under baseDir/policy.Prefix/policy.DBName/ that
+// storage.Partition decides are expired.
+func (s *Storage) Prune(ctx context.Context, policy storage.Policy) (storage.Stats, error) {
+	dir := filepath.Join(s.baseDir, policy.Prefix, policy.DBName)
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return storage.Stats{}, nil
+	}
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	keep, prune, err := storage.Partition(names, policy)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	for _, name := range prune {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return storage.Stats{}, err
+		}
+	}
+
+	log.Printf("local: kept %d, pruned %d", len(keep), len(prune))
+	return storage.Stats{Kept: len(keep), Pruned: len(prune)}, nil
+}
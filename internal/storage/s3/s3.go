@@ -0,0 +1,156 @@
+// Package s3 is the S3-compatible storage.Storage backend, built on
+// minio-go. It is the original backend docker-pg-backup shipped with.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+
+	"github.com/some-programs/docker-pg-backup/internal/storage"
+)
+
+// Storage uploads to an S3-compatible endpoint via minio-go, authenticating
+// with the default minio/AWS credential chain.
+type Storage struct {
+	mc       *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+// New constructs a Storage targeting endpoint/bucket. partSize tunes the
+// multipart uploader's part size in bytes; 0 leaves minio-go's default.
+func New(endpoint, bucket string, partSize uint64) (*Storage, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultAWSCredProviders = []credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+		&credentials.EnvMinio{},
+	}
+	creds := credentials.NewChainCredentials(defaultAWSCredProviders)
+
+	mc, err := minio.New(u.Host, &minio.Options{
+		Creds:        creds,
+		Secure:       true,
+		Region:       s3utils.GetRegionFromURL(*u),
+		BucketLookup: minio.BucketLookupAuto,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{mc: mc, bucket: bucket, partSize: partSize}, nil
+}
+
+func (s *Storage) Name() string { return "s3" }
+
+// Copy streams r to S3 as object remoteName, using PutObject's support for
+// unknown-size (-1) multipart uploads so callers never need to buffer the
+// dump to disk first.
+func (s *Storage) Copy(ctx context.Context, r io.Reader, remoteName string) error {
+	opts := minio.PutObjectOptions{PartSize: s.partSize}
+	if ct := mime.TypeByExtension(path.Ext(remoteName)); ct != "" {
+		opts.ContentType = ct
+	}
+
+	_, err := s.mc.PutObject(ctx, s.bucket, remoteName, r, -1, opts)
+	return err
+}
+
+// Get opens a reader over the object remoteName, for restore/decrypt.
+func (s *Storage) Get(ctx context.Context, remoteName string) (io.ReadCloser, error) {
+	return s.mc.GetObject(ctx, s.bucket, remoteName, minio.GetObjectOptions{})
+}
+
+// Latest returns the most recently named object under prefix/db/, for
+// restore's "latest" object selection.
+func (s *Storage) Latest(ctx context.Context, prefix, db string) (string, error) {
+	keyPrefix := path.Join(prefix, db) + "/"
+
+	var latest string
+	for obj := range s.mc.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    keyPrefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return "", obj.Err
+		}
+		if obj.Key > latest {
+			latest = obj.Key
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no objects found under %s", keyPrefix)
+	}
+	return latest, nil
+}
+
+// Prune lists objects under policy.Prefix/policy.DBName/ and removes the
+// ones storage.Partition decides are expired.
+func (s *Storage) Prune(ctx context.Context, policy storage.Policy) (storage.Stats, error) {
+	prefix := path.Join(policy.Prefix, policy.DBName) + "/"
+
+	var objects []minio.ObjectInfo
+	for obj := range s.mc.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return storage.Stats{}, obj.Err
+		}
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key > objects[j].Key
+	})
+
+	keys := make([]string, len(objects))
+	byKey := make(map[string]minio.ObjectInfo, len(objects))
+	for i, obj := range objects {
+		keys[i] = obj.Key
+		byKey[obj.Key] = obj
+	}
+
+	keep, prune, err := storage.Partition(keys, policy)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+	if len(prune) == 0 {
+		return storage.Stats{Kept: len(keep)}, nil
+	}
+
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, key := range prune {
+			objectsCh <- byKey[key]
+		}
+	}()
+
+	var pruneErr error
+	for res := range s.mc.RemoveObjects(ctx, s.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if res.Err != nil {
+			pruneErr = res.Err
+		}
+	}
+	if pruneErr != nil {
+		return storage.Stats{}, pruneErr
+	}
+
+	log.Printf("s3: kept %d, pruned %d", len(keep), len(prune))
+	return storage.Stats{Kept: len(keep), Pruned: len(prune)}, nil
+}
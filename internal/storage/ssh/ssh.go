@@ -0,0 +1,104 @@
+// Package ssh is a storage.Storage backend that writes backups to a remote
+// host over SFTP.
+package ssh
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/some-programs/docker-pg-backup/internal/storage"
+)
+
+// Storage writes backups under baseDir on a remote host, over SFTP.
+type Storage struct {
+	conn    *ssh.Client
+	client  *sftp.Client
+	baseDir string
+}
+
+// New dials addr (host:port) as user, authenticating with auth, and opens
+// an SFTP session rooted conceptually at baseDir.
+func New(addr, user string, auth ssh.AuthMethod, hostKeyCallback ssh.HostKeyCallback, baseDir string) (*Storage, error) {
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Storage{conn: conn, client: client, baseDir: baseDir}, nil
+}
+
+// Close releases the underlying SFTP session and SSH connection.
+func (s *Storage) Close() error {
+	s.client.Close()
+	return s.conn.Close()
+}
+
+func (s *Storage) Name() string { return "ssh" }
+
+// Copy streams r to baseDir/remoteName on the remote host.
+func (s *Storage) Copy(ctx context.Context, r io.Reader, remoteName string) error {
+	dst := path.Join(s.baseDir, remoteName)
+	if err := s.client.MkdirAll(path.Dir(dst)); err != nil {
+		return err
+	}
+
+	out, err := s.client.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// Prune removes files under baseDir/policy.Prefix/policy.DBName/ that
+// storage.Partition decides are expired.
+func (s *Storage) Prune(ctx context.Context, policy storage.Policy) (storage.Stats, error) {
+	dir := path.Join(s.baseDir, policy.Prefix, policy.DBName)
+
+	entries, err := s.client.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storage.Stats{}, nil
+		}
+		return storage.Stats{}, err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	keep, prune, err := storage.Partition(names, policy)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	for _, name := range prune {
+		if err := s.client.Remove(path.Join(dir, name)); err != nil {
+			return storage.Stats{}, err
+		}
+	}
+
+	log.Printf("ssh: kept %d, pruned %d", len(keep), len(prune))
+	return storage.Stats{Kept: len(keep), Pruned: len(prune)}, nil
+}
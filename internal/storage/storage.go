@@ -0,0 +1,93 @@
+// Package storage defines the interface backup destinations implement, so
+// the backup flow can fan out to several of them without caring how each
+// one persists data.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Policy describes how a backend should prune old backups for a single
+// database.
+type Policy struct {
+	Prefix  string
+	DBName  string
+	Days    int
+	MinKeep int
+	Leeway  time.Duration
+}
+
+// Stats summarizes the outcome of a Prune call.
+type Stats struct {
+	Kept   int
+	Pruned int
+}
+
+// Storage is a backup destination. Implementations are not required to be
+// safe for concurrent use by multiple goroutines.
+type Storage interface {
+	// Name identifies the backend in logs, e.g. "s3" or "local".
+	Name() string
+	// Copy uploads the contents of r under remoteName. Implementations must
+	// read r to completion (or return an error) without buffering it all to
+	// disk first, so callers can stream a dump straight into Copy.
+	Copy(ctx context.Context, r io.Reader, remoteName string) error
+	// Prune removes old backups according to policy.
+	Prune(ctx context.Context, policy Policy) (Stats, error)
+}
+
+// TimeFormat is the timestamp layout backup objects are named with, see
+// main.Backup.
+const TimeFormat = "2006-01-02T15_04_05.999999999"
+
+// knownSuffixes are the file extensions backup objects may carry; at most
+// one is stripped from a name.
+var knownSuffixes = []string{".sql.gz.gpg", ".sql.gz"}
+
+// ParseBackupTime extracts the timestamp encoded in a backup's base name.
+func ParseBackupTime(name string) (time.Time, error) {
+	base := path.Base(name)
+	for _, suffix := range knownSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			base = strings.TrimSuffix(base, suffix)
+			break
+		}
+	}
+	return time.Parse(TimeFormat, base)
+}
+
+// Partition splits names (full paths or keys, sorted newest-first) into the
+// set to keep and the set to prune, per policy. Names that don't parse as
+// backup timestamps are always kept. Returns an error if pruning would
+// remove every entry, as a safety guard against misconfigured policies.
+func Partition(names []string, policy Policy) (keep, prune []string, err error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -policy.Days)
+	leewayCutoff := time.Now().UTC().Add(-policy.Leeway)
+
+	// backups counts parsed backup names seen so far, so unparseable names
+	// don't use up MinKeep's slots.
+	backups := 0
+	for _, name := range names {
+		ts, err := ParseBackupTime(name)
+		if err != nil {
+			keep = append(keep, name)
+			continue
+		}
+		backups++
+		if backups <= policy.MinKeep || ts.After(cutoff) || ts.After(leewayCutoff) {
+			keep = append(keep, name)
+			continue
+		}
+		prune = append(prune, name)
+	}
+
+	if len(prune) > 0 && len(keep) == 0 {
+		return nil, nil, fmt.Errorf("pruning would remove every backup under this prefix, aborting")
+	}
+	return keep, prune, nil
+}
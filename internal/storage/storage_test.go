@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseBackupTime(t *testing.T) {
+	ts := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+	name := ts.Format(TimeFormat)
+
+	cases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "plain", input: name + ".sql.gz"},
+		{name: "encrypted", input: name + ".sql.gz.gpg"},
+		{name: "full path", input: path.Join("prefix", "db", name+".sql.gz")},
+		{name: "unrelated file", input: "readme.txt", wantErr: true},
+		{name: "malformed timestamp", input: "2023-05-01.sql.gz", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseBackupTime(c.input)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("ParseBackupTime(%q) = %v, want error", c.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBackupTime(%q) returned error: %v", c.input, err)
+			}
+			if !got.Equal(ts) {
+				t.Fatalf("ParseBackupTime(%q) = %v, want %v", c.input, got, ts)
+			}
+		})
+	}
+}
+
+// name formats a backup object name suffix old relative to now.
+func name(suffix string, old time.Duration) string {
+	return time.Now().UTC().Add(-old).Format(TimeFormat) + suffix
+}
+
+func TestPartition(t *testing.T) {
+	t.Run("prunes past days beyond min keep", func(t *testing.T) {
+		names := []string{
+			name(".sql.gz", time.Hour),
+			name(".sql.gz", 48*time.Hour),
+			name(".sql.gz", 72*time.Hour),
+		}
+		keep, prune, err := Partition(names, Policy{Days: 2, MinKeep: 1})
+		if err != nil {
+			t.Fatalf("Partition: %v", err)
+		}
+		if len(keep) != 1 || keep[0] != names[0] {
+			t.Fatalf("keep = %v, want only %q", keep, names[0])
+		}
+		if len(prune) != 2 {
+			t.Fatalf("prune = %v, want 2 entries", prune)
+		}
+	})
+
+	t.Run("min keep overrides age", func(t *testing.T) {
+		names := []string{
+			name(".sql.gz", time.Hour),
+			name(".sql.gz", 48*time.Hour),
+			name(".sql.gz", 72*time.Hour),
+		}
+		keep, prune, err := Partition(names, Policy{Days: 0, MinKeep: 2})
+		if err != nil {
+			t.Fatalf("Partition: %v", err)
+		}
+		if len(keep) != 2 {
+			t.Fatalf("keep = %v, want 2 entries kept via MinKeep", keep)
+		}
+		if len(prune) != 1 {
+			t.Fatalf("prune = %v, want 1 entry", prune)
+		}
+	})
+
+	t.Run("leeway grants a recent backup a grace window regardless of days", func(t *testing.T) {
+		names := []string{
+			name(".sql.gz", time.Hour),
+		}
+		keep, prune, err := Partition(names, Policy{Days: 0, Leeway: 2 * time.Hour})
+		if err != nil {
+			t.Fatalf("Partition: %v", err)
+		}
+		if len(keep) != 1 || len(prune) != 0 {
+			t.Fatalf("keep = %v, prune = %v, want the entry kept under leeway", keep, prune)
+		}
+	})
+
+	t.Run("unparseable names are always kept", func(t *testing.T) {
+		names := []string{"not-a-backup.txt", name(".sql.gz", 72*time.Hour)}
+		keep, prune, err := Partition(names, Policy{Days: 1})
+		if err != nil {
+			t.Fatalf("Partition: %v", err)
+		}
+		if len(keep) != 1 || keep[0] != "not-a-backup.txt" {
+			t.Fatalf("keep = %v, want unparseable name kept", keep)
+		}
+		if len(prune) != 1 {
+			t.Fatalf("prune = %v, want 1 entry", prune)
+		}
+	})
+
+	t.Run("encrypted suffix still gets pruned", func(t *testing.T) {
+		names := []string{
+			name(".sql.gz.gpg", time.Hour),
+			name(".sql.gz.gpg", 72*time.Hour),
+		}
+		keep, prune, err := Partition(names, Policy{Days: 1})
+		if err != nil {
+			t.Fatalf("Partition: %v", err)
+		}
+		if len(keep) != 1 || len(prune) != 1 {
+			t.Fatalf("keep = %v, prune = %v, want the expired encrypted backup pruned and the recent one kept", keep, prune)
+		}
+	})
+
+	t.Run("refuses to prune everything", func(t *testing.T) {
+		names := []string{
+			name(".sql.gz", 72*time.Hour),
+			name(".sql.gz", 96*time.Hour),
+		}
+		_, _, err := Partition(names, Policy{Days: 1})
+		if err == nil {
+			t.Fatal("Partition returned no error for a policy that would prune every backup")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// Package webdav is a storage.Storage backend that writes backups to a
+// WebDAV server.
+package webdav
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/studio-b12/gowebdav"
+
+	"github.com/some-programs/docker-pg-backup/internal/storage"
+)
+
+// Storage writes backups under baseDir on a WebDAV server.
+type Storage struct {
+	client  *gowebdav.Client
+	baseDir string
+}
+
+// New constructs a Storage targeting the WebDAV server at url, authenticating
+// with user/password (either may be empty).
+func New(url, user, password, baseDir string) *Storage {
+	return &Storage{
+		client:  gowebdav.NewClient(url, user, password),
+		baseDir: baseDir,
+	}
+}
+
+func (s *Storage) Name() string { return "webdav" }
+
+// Copy streams r to baseDir/remoteName on the server.
+func (s *Storage) Copy(ctx context.Context, r io.Reader, remoteName string) error {
+	dst := path.Join(s.baseDir, remoteName)
+	if err := s.client.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	return s.client.WriteStream(dst, r, 0o644)
+}
+
+// Prune removes files under baseDir/policy.Prefix/policy.DBName/ that
+// storage.Partition decides are expired.
+func (s *Storage) Prune(ctx context.Context, policy storage.Policy) (storage.Stats, error) {
+	dir := path.Join(s.baseDir, policy.Prefix, policy.DBName)
+
+	infos, err := s.client.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storage.Stats{}, nil
+		}
+		return storage.Stats{}, err
+	}
+
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	keep, prune, err := storage.Partition(names, policy)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	for _, name := range prune {
+		if err := s.client.Remove(path.Join(dir, name)); err != nil {
+			return storage.Stats{}, err
+		}
+	}
+
+	log.Printf("webdav: kept %d, pruned %d", len(keep), len(prune))
+	return storage.Stats{Kept: len(keep), Pruned: len(prune)}, nil
+}